@@ -36,6 +36,7 @@ func newGenerator() *generator {
 type generator struct {
 	reg    *typemap.Registry
 	output *bytes.Buffer
+	redact []string
 }
 
 func (g *generator) Generate(in *plugin.CodeGeneratorRequest) (*plugin.CodeGeneratorResponse, error) {
@@ -44,6 +45,7 @@ func (g *generator) Generate(in *plugin.CodeGeneratorRequest) (*plugin.CodeGener
 		return nil, err
 	}
 	g.reg = typemap.New(in.ProtoFile)
+	g.redact = parseRedactParam(in.GetParameter())
 
 	resp := new(plugin.CodeGeneratorResponse)
 	for _, f := range genFiles {
@@ -107,6 +109,7 @@ func (g *generator) generateProtobufAnalytics(file *descriptor.FileDescriptorPro
 		g.P("\tvar track analytics.Track")
 		g.P("\ttrack.Event = ", `"`, serviceName(service), " ", methName, `"`)
 		g.P("\ttrack.UserId = ln.GetFFromContext(ctx)[\"x_forwarded_for\"].(string)")
+		g.generateTrackProperties(file, method)
 		g.P("\tdefer func() {")
 		g.P("\t\tif err != nil {")
 		g.P("\t\t\ttrack.Event += ", `" Error"`)
@@ -124,6 +127,61 @@ func (g *generator) generateProtobufAnalytics(file *descriptor.FileDescriptorPro
 	}
 }
 
+// generateTrackProperties emits assignments that copy the method's input
+// fields onto track.Properties, redacting anything isRestricted flags and
+// recursing into nested messages the same way the logging codegen does.
+func (g *generator) generateTrackProperties(file *descriptor.FileDescriptorProto, method *descriptor.MethodDescriptorProto) {
+	message := findMessage(file, methodInputName(method))
+	if message == nil || len(message.Field) == 0 {
+		return
+	}
+
+	g.P("\ttrack.Properties = analytics.NewProperties()")
+	g.emitTrackFields(file, message, "input", "")
+}
+
+// emitTrackFields walks message's fields, appending Properties.Set calls for
+// scalars (redacting restricted ones) and recursing into nested messages
+// under accessor, prefixing their keys with keyPrefix.
+func (g *generator) emitTrackFields(file *descriptor.FileDescriptorProto, message *descriptor.DescriptorProto, accessor, keyPrefix string) {
+	for _, field := range message.Field {
+		fieldGoName := stringutils.CamelCase(field.GetName())
+		key := keyPrefix + field.GetName()
+		fieldAccessor := accessor + "." + fieldGoName
+
+		if isRestricted(field.GetName(), g.redact) {
+			g.P("\ttrack.Properties.Set(\"", key, "\", \"[REDACTED]\")")
+			continue
+		}
+
+		if field.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE {
+			if nested := findMessage(file, typeBasename(field.GetTypeName())); nested != nil {
+				g.emitTrackFields(file, nested, fieldAccessor, key+"_")
+				continue
+			}
+		}
+
+		g.P("\ttrack.Properties.Set(\"", key, "\", ", fieldAccessor, ")")
+	}
+}
+
+// typeBasename returns the basename of a fully-qualified proto type name
+// such as ".us.xeserv.api.Words".
+func typeBasename(fullName string) string {
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}
+
+// findMessage looks up a top-level message type by name within file.
+func findMessage(file *descriptor.FileDescriptorProto, name string) *descriptor.DescriptorProto {
+	for _, message := range file.MessageType {
+		if message.GetName() == name {
+			return message
+		}
+	}
+	return nil
+}
+
 func (g *generator) P(args ...string) {
 	for _, v := range args {
 		g.output.WriteString(v)
@@ -0,0 +1,37 @@
+package main
+
+import "strings"
+
+var defaultRestricted = []string{"password", "token", "secret", "auth"}
+
+// isRestricted reports whether a field name looks like it holds sensitive
+// data and should be redacted before it reaches analytics.Track.Properties.
+// extra is an additional deny-list supplied via the --twirp_analytics_out
+// plugin parameter (e.g. "redact=email,ssn") so callers can extend the
+// default list without editing this generator.
+func isRestricted(inp string, extra []string) bool {
+	for _, thing := range defaultRestricted {
+		if strings.Contains(inp, thing) {
+			return true
+		}
+	}
+
+	for _, thing := range extra {
+		if thing != "" && strings.Contains(inp, thing) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseRedactParam extracts the comma-separated deny-list from a plugin
+// parameter of the form "redact=email,ssn".
+func parseRedactParam(param string) []string {
+	const prefix = "redact="
+	if !strings.HasPrefix(param, prefix) {
+		return nil
+	}
+
+	return strings.Split(strings.TrimPrefix(param, prefix), ",")
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"github.com/twitchtv/protogen"
+	"github.com/twitchtv/protogen/stringutils"
+	"github.com/twitchtv/protogen/typemap"
+)
+
+const version = "v0.0.1"
+
+func main() {
+	versionFlag := flag.Bool("version", false, "print version and exit")
+	flag.Parse()
+	if *versionFlag {
+		fmt.Println(version)
+		os.Exit(0)
+	}
+
+	g := newGenerator()
+	protogen.RunProtocPlugin(g)
+}
+
+func newGenerator() *generator {
+	return &generator{output: new(bytes.Buffer)}
+}
+
+type generator struct {
+	reg    *typemap.Registry
+	output *bytes.Buffer
+	redact []string
+}
+
+func (g *generator) Generate(in *plugin.CodeGeneratorRequest) (*plugin.CodeGeneratorResponse, error) {
+	genFiles, err := protogen.FilesToGenerate(in)
+	if err != nil {
+		return nil, err
+	}
+	g.reg = typemap.New(in.ProtoFile)
+	g.redact = parseRedactParam(in.GetParameter())
+
+	resp := new(plugin.CodeGeneratorResponse)
+	for _, f := range genFiles {
+		respFile := g.generateFile(f)
+		if respFile != nil {
+			resp.File = append(resp.File, respFile)
+		}
+	}
+	return resp, nil
+}
+
+func (g *generator) generateFile(file *descriptor.FileDescriptorProto) *plugin.CodeGeneratorResponse_File {
+	g.P("// Code generated by protoc-gen-twirp_ln ", version, ", DO NOT EDIT.")
+	g.P("// source: ", file.GetName())
+	g.P("")
+
+	pkgname, _ := goPackageName(file)
+
+	g.P("package ", pkgname)
+	g.P()
+
+	g.P(`import "context"`)
+	g.P(`import "github.com/Xe/ln"`)
+	g.P()
+
+	for _, service := range file.Service {
+		g.generateProtobufLogging(file, service)
+	}
+
+	for _, message := range file.MessageType {
+		g.generateMessageF(message)
+	}
+
+	resp := new(plugin.CodeGeneratorResponse_File)
+	resp.Name = proto.String(goFileName(file))
+	resp.Content = proto.String(g.output.String())
+	g.output.Reset()
+
+	return resp
+}
+
+func (g *generator) generateProtobufLogging(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) {
+	svcName := serviceName(service) + "Logging"
+	g.P("// ", svcName, " is a middleware for ", serviceName(service), " that logs all usage of the methods")
+	g.P("type ", svcName, " struct {")
+	g.P("\tnext ", serviceName(service))
+	g.P("}")
+	g.P()
+
+	g.P("func New", svcName, "(next ", serviceName(service), ") ", serviceName(service), " {")
+	g.P("\tvar result ", svcName)
+	g.P("\tresult.next = next")
+	g.P("\treturn result")
+	g.P("}")
+	g.P()
+
+	for _, method := range service.Method {
+		methName := methodName(method)
+		miType := methodInputName(method)
+		moType := methodOutputName(method)
+		g.P("func (i ", svcName, ") ", methName, "(ctx context.Context, input *", miType, ") (result *", moType, ", err error) {")
+		g.P("\tctx = ln.WithF(ctx, ln.F{")
+		g.P("\t\t\"twirp_package\": ", `"`, file.GetPackage(), `",`)
+		g.P("\t\t\"twirp_service\": ", `"`, serviceName(service), `",`)
+		g.P("\t\t\"twirp_method\": ", `"`, methName, `",`)
+		g.P("\t})")
+		g.P("\tresult, err = i.next.", methName, "(ctx, input)")
+		g.P("\tif err != nil {")
+		g.P("\t\tln.Error(ctx, err, input)")
+		g.P("\t}")
+		g.P("\treturn")
+		g.P("}")
+		g.P()
+	}
+}
+
+// generateMessageF emits an F() method on message that turns its fields into
+// an ln.F suitable for structured logging, redacting anything isRestricted
+// flags and merging in the F() of any nested messages.
+func (g *generator) generateMessageF(message *descriptor.DescriptorProto) {
+	msgName := stringutils.CamelCase(message.GetName())
+	prefix := strings.ToLower(message.GetName())
+
+	g.P("// F ields for logging.")
+	g.P("func (i ", msgName, ") F() ln.F {")
+	g.P("\tresult := ln.F{}")
+	g.P()
+
+	for _, field := range message.Field {
+		fieldGoName := stringutils.CamelCase(field.GetName())
+		key := prefix + "_" + field.GetName()
+
+		if isRestricted(field.GetName(), g.redact) {
+			g.P("\tresult[\"", key, "\"] = \"[REDACTED]\"")
+			continue
+		}
+
+		// Singular message fields are *T in generated Go, so F() must be
+		// guarded against nil; repeated message fields are []*T and have
+		// no F() method at all, so they fall through and get logged as-is.
+		if field.GetType() == descriptor.FieldDescriptorProto_TYPE_MESSAGE &&
+			field.GetLabel() != descriptor.FieldDescriptorProto_LABEL_REPEATED {
+			g.P("\tif i.", fieldGoName, " != nil {")
+			g.P("\t\tfor k, v := range i.", fieldGoName, ".F() {")
+			g.P("\t\t\tresult[k] = v")
+			g.P("\t\t}")
+			g.P("\t}")
+			continue
+		}
+
+		g.P("\tresult[\"", key, "\"] = i.", fieldGoName)
+	}
+
+	g.P()
+	g.P("\treturn result")
+	g.P("}")
+	g.P()
+}
+
+func (g *generator) P(args ...string) {
+	for _, v := range args {
+		g.output.WriteString(v)
+	}
+	g.output.WriteByte('\n')
+}
+
+func (g *generator) printComments(comments typemap.DefinitionComments, prefix string) {
+	text := strings.TrimSuffix(comments.Leading, "\n")
+	for _, line := range strings.Split(text, "\n") {
+		g.P(prefix, strings.TrimPrefix(line, " "))
+	}
+}
+
+func serviceName(service *descriptor.ServiceDescriptorProto) string {
+	return stringutils.CamelCase(service.GetName())
+}
+
+func clientName(service *descriptor.ServiceDescriptorProto) string {
+	return serviceName(service) + "Client"
+}
+
+func fullServiceName(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) string {
+	name := serviceName(service)
+	if pkg := file.GetPackage(); pkg != "" {
+		name = pkg + "." + name
+	}
+	return name
+}
+
+func methodName(method *descriptor.MethodDescriptorProto) string {
+	return method.GetName()
+}
+
+// methodOutputName returns the basename of the output type of a method.
+func methodOutputName(meth *descriptor.MethodDescriptorProto) string {
+	fullName := meth.GetOutputType()
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}
+
+// methodInputName returns the basename of the input type of a method.
+func methodInputName(meth *descriptor.MethodDescriptorProto) string {
+	fullName := meth.GetInputType()
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+func TestGenerateMessageFRedactsBeforeRecursingIntoNestedMessage(t *testing.T) {
+	message := &descriptor.DescriptorProto{
+		Name: proto.String("LoginRequest"),
+		Field: []*descriptor.FieldDescriptorProto{
+			{
+				Name:     proto.String("auth_details"),
+				Type:     descriptor.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				Label:    descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				TypeName: proto.String(".test.AuthDetails"),
+			},
+		},
+	}
+
+	g := newGenerator()
+	g.redact = []string{"auth_details"}
+	g.generateMessageF(message)
+	out := g.output.String()
+
+	if !strings.Contains(out, `result["loginrequest_auth_details"] = "[REDACTED]"`) {
+		t.Fatalf("expected restricted field to be redacted, got:\n%s", out)
+	}
+	if strings.Contains(out, "AuthDetails.F()") {
+		t.Fatalf("restricted nested message must not be recursed into, got:\n%s", out)
+	}
+}
+
+func TestGenerateMessageFGuardsNilNestedMessage(t *testing.T) {
+	message := &descriptor.DescriptorProto{
+		Name: proto.String("LoginRequest"),
+		Field: []*descriptor.FieldDescriptorProto{
+			{
+				Name:     proto.String("profile"),
+				Type:     descriptor.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				Label:    descriptor.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+				TypeName: proto.String(".test.Profile"),
+			},
+		},
+	}
+
+	g := newGenerator()
+	g.generateMessageF(message)
+	out := g.output.String()
+
+	if !strings.Contains(out, "if i.Profile != nil {") {
+		t.Fatalf("expected nil guard before calling Profile.F(), got:\n%s", out)
+	}
+}
+
+func TestGenerateMessageFDoesNotRecurseRepeatedMessage(t *testing.T) {
+	message := &descriptor.DescriptorProto{
+		Name: proto.String("LoginRequest"),
+		Field: []*descriptor.FieldDescriptorProto{
+			{
+				Name:     proto.String("sessions"),
+				Type:     descriptor.FieldDescriptorProto_TYPE_MESSAGE.Enum(),
+				Label:    descriptor.FieldDescriptorProto_LABEL_REPEATED.Enum(),
+				TypeName: proto.String(".test.Session"),
+			},
+		},
+	}
+
+	g := newGenerator()
+	g.generateMessageF(message)
+	out := g.output.String()
+
+	// []*T has no F() method, so a repeated message field must fall through
+	// to a plain assignment instead of a recursive range over Sessions.F().
+	if strings.Contains(out, ".F()") {
+		t.Fatalf("repeated message field must not call F(), got:\n%s", out)
+	}
+	if !strings.Contains(out, `result["loginrequest_sessions"] = i.Sessions`) {
+		t.Fatalf("expected repeated field to be assigned as-is, got:\n%s", out)
+	}
+}
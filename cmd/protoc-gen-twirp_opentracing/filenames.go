@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+)
+
+// goPackageName returns the Go package name that generated code for file
+// should live in: the file's go_package option when set, falling back to
+// its proto package.
+func goPackageName(file *descriptor.FileDescriptorProto) (string, bool) {
+	if opts := file.GetOptions(); opts != nil && opts.GoPackage != nil {
+		pkg := opts.GetGoPackage()
+		if idx := strings.LastIndex(pkg, ";"); idx >= 0 {
+			return pkg[idx+1:], true
+		}
+		if idx := strings.LastIndex(pkg, "/"); idx >= 0 {
+			return pkg[idx+1:], true
+		}
+		return pkg, true
+	}
+
+	return file.GetPackage(), false
+}
+
+// goFileName returns the name of the Go file this plugin emits for file,
+// e.g. "service.proto" becomes "service.twirp.opentracing.go".
+func goFileName(file *descriptor.FileDescriptorProto) string {
+	name := file.GetName()
+	name = strings.TrimSuffix(name, path.Ext(name))
+	return name + ".twirp.opentracing.go"
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"github.com/twitchtv/protogen"
+	"github.com/twitchtv/protogen/stringutils"
+	"github.com/twitchtv/protogen/typemap"
+)
+
+const version = "v0.0.1"
+
+func main() {
+	versionFlag := flag.Bool("version", false, "print version and exit")
+	flag.Parse()
+	if *versionFlag {
+		fmt.Println(version)
+		os.Exit(0)
+	}
+
+	g := newGenerator()
+	protogen.RunProtocPlugin(g)
+}
+
+func newGenerator() *generator {
+	return &generator{output: new(bytes.Buffer)}
+}
+
+type generator struct {
+	reg    *typemap.Registry
+	output *bytes.Buffer
+}
+
+func (g *generator) Generate(in *plugin.CodeGeneratorRequest) (*plugin.CodeGeneratorResponse, error) {
+	genFiles, err := protogen.FilesToGenerate(in)
+	if err != nil {
+		return nil, err
+	}
+	g.reg = typemap.New(in.ProtoFile)
+
+	resp := new(plugin.CodeGeneratorResponse)
+	for _, f := range genFiles {
+		respFile := g.generateFile(f)
+		if respFile != nil {
+			resp.File = append(resp.File, respFile)
+		}
+	}
+	return resp, nil
+}
+
+func (g *generator) generateFile(file *descriptor.FileDescriptorProto) *plugin.CodeGeneratorResponse_File {
+	g.P("// Code generated by protoc-gen-twirp_opentracing ", version, ", DO NOT EDIT.")
+	g.P("// source: ", file.GetName())
+	g.P("")
+
+	pkgname, _ := goPackageName(file)
+
+	g.P("package ", pkgname)
+	g.P()
+
+	g.P(`import "context"`)
+	g.P(`import "net/http"`)
+	g.P(`import "github.com/Xe/ln"`)
+	g.P(`import "github.com/opentracing/opentracing-go"`)
+	g.P(`import "github.com/opentracing/opentracing-go/ext"`)
+	g.P(`import "github.com/opentracing/opentracing-go/log"`)
+	g.P(`import "github.com/twitchtv/twirp"`)
+	g.P()
+
+	for _, service := range file.Service {
+		g.generateProtobufTracing(file, service)
+		g.generateProtobufTracingClient(file, service)
+	}
+
+	resp := new(plugin.CodeGeneratorResponse_File)
+	resp.Name = proto.String(goFileName(file))
+	resp.Content = proto.String(g.output.String())
+	g.output.Reset()
+
+	return resp
+}
+
+func (g *generator) generateProtobufTracing(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) {
+	svcName := serviceName(service) + "Tracing"
+
+	g.P("// ", svcName, " is a server-side middleware for ", serviceName(service), " that starts a span for each RPC.")
+	g.P("type ", svcName, " struct {")
+	g.P("\tNext   ", serviceName(service))
+	g.P("\tTracer opentracing.Tracer")
+	g.P("}")
+	g.P()
+
+	g.P("func New", svcName, "(next ", serviceName(service), ", tracer opentracing.Tracer) ", serviceName(service), " {")
+	g.P("\tvar result ", svcName)
+	g.P("\tresult.Next = next")
+	g.P("\tresult.Tracer = tracer")
+	g.P("\treturn result")
+	g.P("}")
+	g.P()
+
+	for _, method := range service.Method {
+		methName := methodName(method)
+		miType := methodInputName(method)
+		moType := methodOutputName(method)
+		opName := fullServiceName(file, service) + "/" + methName
+
+		g.P("func (i ", svcName, ") ", methName, "(ctx context.Context, input *", miType, ") (result *", moType, ", err error) {")
+		g.P("\tspan, ctx := opentracing.StartSpanFromContextWithTracer(ctx, i.Tracer, \"", opName, "\")")
+		g.P("\tdefer span.Finish()")
+		g.P()
+		g.P("\text.SpanKindRPCServer.Set(span)")
+		g.P("\text.Component.Set(span, \"twirp\")")
+		g.P("\tif f, ok := ln.FFromContext(ctx); ok {")
+		g.P("\t\tif peer, ok := f[\"peer.service\"]; ok {")
+		g.P("\t\t\tspan.SetTag(\"peer.service\", peer)")
+		g.P("\t\t}")
+		g.P("\t}")
+		g.P("\tctx = opentracing.ContextWithSpan(ctx, span)")
+		g.P()
+		g.P("\tresult, err = i.Next.", methName, "(ctx, input)")
+		g.P("\tif err != nil {")
+		g.P("\t\text.Error.Set(span, true)")
+		g.P("\t\tspan.LogFields(log.Error(err))")
+		g.P("\t}")
+		g.P("\treturn")
+		g.P("}")
+		g.P()
+	}
+}
+
+func (g *generator) generateProtobufTracingClient(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) {
+	svcName := serviceName(service) + "TracingClient"
+
+	g.P("// ", svcName, " is a client-side middleware for ", serviceName(service), " that propagates the")
+	g.P("// active span across the twirp hop via HTTP headers.")
+	g.P("type ", svcName, " struct {")
+	g.P("\tNext   ", serviceName(service))
+	g.P("\tTracer opentracing.Tracer")
+	g.P("}")
+	g.P()
+
+	g.P("func New", svcName, "(next ", serviceName(service), ", tracer opentracing.Tracer) ", serviceName(service), " {")
+	g.P("\tvar result ", svcName)
+	g.P("\tresult.Next = next")
+	g.P("\tresult.Tracer = tracer")
+	g.P("\treturn result")
+	g.P("}")
+	g.P()
+
+	for _, method := range service.Method {
+		methName := methodName(method)
+		miType := methodInputName(method)
+		moType := methodOutputName(method)
+		opName := fullServiceName(file, service) + "/" + methName
+
+		g.P("func (i ", svcName, ") ", methName, "(ctx context.Context, input *", miType, ") (result *", moType, ", err error) {")
+		g.P("\tvar span opentracing.Span")
+		g.P("\tif parent := opentracing.SpanFromContext(ctx); parent != nil {")
+		g.P("\t\tspan = i.Tracer.StartSpan(\"", opName, "\", opentracing.ChildOf(parent.Context()))")
+		g.P("\t} else {")
+		g.P("\t\tspan = i.Tracer.StartSpan(\"", opName, "\")")
+		g.P("\t}")
+		g.P("\tdefer span.Finish()")
+		g.P("\tctx = opentracing.ContextWithSpan(ctx, span)")
+		g.P()
+		g.P("\theader := make(http.Header)")
+		g.P("\tif err := i.Tracer.Inject(span.Context(), opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(header)); err != nil {")
+		g.P("\t\tln.Error(ctx, err)")
+		g.P("\t}")
+		g.P("\tctx, err = twirp.WithHTTPRequestHeaders(ctx, header)")
+		g.P("\tif err != nil {")
+		g.P("\t\treturn nil, err")
+		g.P("\t}")
+		g.P()
+		g.P("\tresult, err = i.Next.", methName, "(ctx, input)")
+		g.P("\tif err != nil {")
+		g.P("\t\text.Error.Set(span, true)")
+		g.P("\t\tspan.LogFields(log.Error(err))")
+		g.P("\t}")
+		g.P("\treturn")
+		g.P("}")
+		g.P()
+	}
+}
+
+func (g *generator) P(args ...string) {
+	for _, v := range args {
+		g.output.WriteString(v)
+	}
+	g.output.WriteByte('\n')
+}
+
+func (g *generator) printComments(comments typemap.DefinitionComments, prefix string) {
+	text := strings.TrimSuffix(comments.Leading, "\n")
+	for _, line := range strings.Split(text, "\n") {
+		g.P(prefix, strings.TrimPrefix(line, " "))
+	}
+}
+
+func serviceName(service *descriptor.ServiceDescriptorProto) string {
+	return stringutils.CamelCase(service.GetName())
+}
+
+func clientName(service *descriptor.ServiceDescriptorProto) string {
+	return serviceName(service) + "Client"
+}
+
+func fullServiceName(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) string {
+	name := serviceName(service)
+	if pkg := file.GetPackage(); pkg != "" {
+		name = pkg + "." + name
+	}
+	return name
+}
+
+func methodName(method *descriptor.MethodDescriptorProto) string {
+	return method.GetName()
+}
+
+// methodOutputName returns the basename of the output type of a method.
+func methodOutputName(meth *descriptor.MethodDescriptorProto) string {
+	fullName := meth.GetOutputType()
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}
+
+// methodInputName returns the basename of the input type of a method.
+func methodInputName(meth *descriptor.MethodDescriptorProto) string {
+	fullName := meth.GetInputType()
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}
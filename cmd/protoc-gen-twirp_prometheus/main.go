@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"github.com/twitchtv/protogen"
+	"github.com/twitchtv/protogen/stringutils"
+	"github.com/twitchtv/protogen/typemap"
+)
+
+const version = "v0.0.1"
+
+func main() {
+	versionFlag := flag.Bool("version", false, "print version and exit")
+	flag.Parse()
+	if *versionFlag {
+		fmt.Println(version)
+		os.Exit(0)
+	}
+
+	g := newGenerator()
+	protogen.RunProtocPlugin(g)
+}
+
+func newGenerator() *generator {
+	return &generator{output: new(bytes.Buffer)}
+}
+
+type generator struct {
+	reg    *typemap.Registry
+	output *bytes.Buffer
+}
+
+func (g *generator) Generate(in *plugin.CodeGeneratorRequest) (*plugin.CodeGeneratorResponse, error) {
+	genFiles, err := protogen.FilesToGenerate(in)
+	if err != nil {
+		return nil, err
+	}
+	g.reg = typemap.New(in.ProtoFile)
+
+	resp := new(plugin.CodeGeneratorResponse)
+	for _, f := range genFiles {
+		respFile := g.generateFile(f)
+		if respFile != nil {
+			resp.File = append(resp.File, respFile)
+		}
+	}
+	return resp, nil
+}
+
+func (g *generator) generateFile(file *descriptor.FileDescriptorProto) *plugin.CodeGeneratorResponse_File {
+	g.P("// Code generated by protoc-gen-twirp_prometheus ", version, ", DO NOT EDIT.")
+	g.P("// source: ", file.GetName())
+	g.P("")
+
+	pkgname, _ := goPackageName(file)
+
+	g.P("package ", pkgname)
+	g.P()
+
+	g.P(`import "context"`)
+	g.P(`import "time"`)
+	g.P(`import "github.com/prometheus/client_golang/prometheus"`)
+	g.P(`import "github.com/twitchtv/twirp"`)
+	g.P()
+
+	for _, service := range file.Service {
+		g.generateProtobufPrometheus(file, service)
+	}
+
+	resp := new(plugin.CodeGeneratorResponse_File)
+	resp.Name = proto.String(goFileName(file))
+	resp.Content = proto.String(g.output.String())
+	g.output.Reset()
+
+	return resp
+}
+
+func (g *generator) generateProtobufPrometheus(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) {
+	svcName := serviceName(service) + "Prometheus"
+	pkgName := file.GetPackage()
+	svcLabel := serviceName(service)
+
+	// Collectors are scoped to the service via the metric name itself, not
+	// just label values: prometheus.Registerer.Register keys on the metric's
+	// descriptor (fqName + label names), so two services sharing a bare
+	// "twirp_requests_total" name would collide on the second registration.
+	metricPrefix := "twirp_" + metricNameComponent(pkgName) + "_" + metricNameComponent(svcLabel)
+
+	g.P("// ", svcName, " is a middleware for ", serviceName(service), " that records request counts, durations and in-flight gauges to Prometheus.")
+	g.P("type ", svcName, " struct {")
+	g.P("\tNext ", serviceName(service))
+	g.P("\trequestTotal *prometheus.CounterVec")
+	g.P("\trequestDuration *prometheus.HistogramVec")
+	g.P("\trequestsInFlight *prometheus.GaugeVec")
+	g.P("}")
+	g.P()
+
+	g.P("func New", svcName, "(next ", serviceName(service), ", reg prometheus.Registerer) (", serviceName(service), ", error) {")
+	g.P("\tvar result ", svcName)
+	g.P("\tresult.Next = next")
+	g.P()
+	g.P("\tresult.requestTotal = prometheus.NewCounterVec(prometheus.CounterOpts{")
+	g.P("\t\tName: \"", metricPrefix, "_requests_total\",")
+	g.P("\t\tHelp: \"Total number of twirp requests handled, labeled by result code.\",")
+	g.P("\t}, []string{\"package\", \"service\", \"method\", \"code\"})")
+	g.P()
+	g.P("\tresult.requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{")
+	g.P("\t\tName: \"", metricPrefix, "_request_duration_seconds\",")
+	g.P("\t\tHelp: \"Twirp request duration in seconds, labeled by result code.\",")
+	g.P("\t\tBuckets: prometheus.DefBuckets,")
+	g.P("\t}, []string{\"package\", \"service\", \"method\", \"code\"})")
+	g.P()
+	g.P("\tresult.requestsInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{")
+	g.P("\t\tName: \"", metricPrefix, "_requests_in_flight\",")
+	g.P("\t\tHelp: \"Number of twirp requests currently being served.\",")
+	g.P("\t}, []string{\"package\", \"service\", \"method\"})")
+	g.P()
+	g.P("\tregistered := make([]prometheus.Collector, 0, 3)")
+	g.P("\tfor _, c := range []prometheus.Collector{result.requestTotal, result.requestDuration, result.requestsInFlight} {")
+	g.P("\t\tif err := reg.Register(c); err != nil {")
+	g.P("\t\t\tfor _, r := range registered {")
+	g.P("\t\t\t\treg.Unregister(r)")
+	g.P("\t\t\t}")
+	g.P("\t\t\treturn nil, err")
+	g.P("\t\t}")
+	g.P("\t\tregistered = append(registered, c)")
+	g.P("\t}")
+	g.P()
+	g.P("\treturn result, nil")
+	g.P("}")
+	g.P()
+
+	for _, method := range service.Method {
+		methName := methodName(method)
+		miType := methodInputName(method)
+		moType := methodOutputName(method)
+		g.P("func (i ", svcName, ") ", methName, "(ctx context.Context, input *", miType, ") (result *", moType, ", err error) {")
+		g.P("\tinFlight := i.requestsInFlight.WithLabelValues(\"", pkgName, "\", \"", svcLabel, "\", \"", methName, "\")")
+		g.P("\tinFlight.Inc()")
+		g.P("\tdefer inFlight.Dec()")
+		g.P()
+		g.P("\tstart := time.Now()")
+		g.P("\tdefer func() {")
+		g.P("\t\tcode := \"ok\"")
+		g.P("\t\tif err != nil {")
+		g.P("\t\t\tcode = string(twirp.ErrorCode(err))")
+		g.P("\t\t}")
+		g.P("\t\ti.requestTotal.WithLabelValues(\"", pkgName, "\", \"", svcLabel, "\", \"", methName, "\", code).Inc()")
+		g.P("\t\ti.requestDuration.WithLabelValues(\"", pkgName, "\", \"", svcLabel, "\", \"", methName, "\", code).Observe(time.Since(start).Seconds())")
+		g.P("\t}()")
+		g.P()
+		g.P("\tresult, err = i.Next.", methName, "(ctx, input)")
+		g.P("\treturn")
+		g.P("}")
+		g.P()
+	}
+}
+
+func (g *generator) P(args ...string) {
+	for _, v := range args {
+		g.output.WriteString(v)
+	}
+	g.output.WriteByte('\n')
+}
+
+func (g *generator) printComments(comments typemap.DefinitionComments, prefix string) {
+	text := strings.TrimSuffix(comments.Leading, "\n")
+	for _, line := range strings.Split(text, "\n") {
+		g.P(prefix, strings.TrimPrefix(line, " "))
+	}
+}
+
+func serviceName(service *descriptor.ServiceDescriptorProto) string {
+	return stringutils.CamelCase(service.GetName())
+}
+
+func clientName(service *descriptor.ServiceDescriptorProto) string {
+	return serviceName(service) + "Client"
+}
+
+func fullServiceName(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) string {
+	name := serviceName(service)
+	if pkg := file.GetPackage(); pkg != "" {
+		name = pkg + "." + name
+	}
+	return name
+}
+
+// metricNameComponent lowercases s and replaces anything that isn't a valid
+// Prometheus metric name character with an underscore, so it can be spliced
+// into a metric name to distinguish one service's collectors from another's.
+func metricNameComponent(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+	return b.String()
+}
+
+func methodName(method *descriptor.MethodDescriptorProto) string {
+	return method.GetName()
+}
+
+// methodOutputName returns the basename of the output type of a method.
+func methodOutputName(meth *descriptor.MethodDescriptorProto) string {
+	fullName := meth.GetOutputType()
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}
+
+// methodInputName returns the basename of the input type of a method.
+func methodInputName(meth *descriptor.MethodDescriptorProto) string {
+	fullName := meth.GetInputType()
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}
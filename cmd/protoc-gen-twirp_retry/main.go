@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/protoc-gen-go/descriptor"
+	plugin "github.com/golang/protobuf/protoc-gen-go/plugin"
+	"github.com/twitchtv/protogen"
+	"github.com/twitchtv/protogen/stringutils"
+	"github.com/twitchtv/protogen/typemap"
+)
+
+const version = "v0.0.1"
+
+func main() {
+	versionFlag := flag.Bool("version", false, "print version and exit")
+	flag.Parse()
+	if *versionFlag {
+		fmt.Println(version)
+		os.Exit(0)
+	}
+
+	g := newGenerator()
+	protogen.RunProtocPlugin(g)
+}
+
+func newGenerator() *generator {
+	return &generator{output: new(bytes.Buffer)}
+}
+
+type generator struct {
+	reg    *typemap.Registry
+	output *bytes.Buffer
+}
+
+func (g *generator) Generate(in *plugin.CodeGeneratorRequest) (*plugin.CodeGeneratorResponse, error) {
+	genFiles, err := protogen.FilesToGenerate(in)
+	if err != nil {
+		return nil, err
+	}
+	g.reg = typemap.New(in.ProtoFile)
+
+	resp := new(plugin.CodeGeneratorResponse)
+	for _, f := range genFiles {
+		respFile := g.generateFile(f)
+		if respFile != nil {
+			resp.File = append(resp.File, respFile)
+		}
+	}
+	return resp, nil
+}
+
+func (g *generator) generateFile(file *descriptor.FileDescriptorProto) *plugin.CodeGeneratorResponse_File {
+	g.P("// Code generated by protoc-gen-twirp_retry ", version, ", DO NOT EDIT.")
+	g.P("// source: ", file.GetName())
+	g.P("")
+
+	pkgname, _ := goPackageName(file)
+
+	g.P("package ", pkgname)
+	g.P()
+
+	g.P(`import "context"`)
+	g.P(`import "math/rand"`)
+	g.P(`import "net"`)
+	g.P(`import "time"`)
+	g.P(`import "github.com/pkg/errors"`)
+	g.P(`import "github.com/twitchtv/twirp"`)
+	g.P()
+
+	for _, service := range file.Service {
+		g.generateProtobufRetry(file, service)
+	}
+
+	resp := new(plugin.CodeGeneratorResponse_File)
+	resp.Name = proto.String(goFileName(file))
+	resp.Content = proto.String(g.output.String())
+	g.output.Reset()
+
+	return resp
+}
+
+func (g *generator) generateProtobufRetry(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) {
+	svcName := serviceName(service) + "Retry"
+	configName := serviceName(service) + "RetryConfig"
+	isRetryableName := "is" + serviceName(service) + "RetryableError"
+
+	g.P("// ", configName, " configures the backoff behavior of ", svcName, ".")
+	g.P("type ", configName, " struct {")
+	g.P("\t// MaxRetries is the number of retries attempted after the initial call.")
+	g.P("\t// It defaults to 0, so callers must opt into retries explicitly.")
+	g.P("\tMaxRetries int")
+	g.P("\tBaseDelay  time.Duration")
+	g.P("\tMaxDelay   time.Duration")
+	g.P("\tJitter     bool")
+	g.P("}")
+	g.P()
+
+	g.P("// ", isRetryableName, " reports whether err represents a transient failure")
+	g.P("// worth retrying: a twirp.Error with a transient code, or a net.Error")
+	g.P("// reporting a timeout or temporary failure.")
+	g.P("func ", isRetryableName, "(err error) bool {")
+	g.P("\tif twerr, ok := err.(twirp.Error); ok {")
+	g.P("\t\tswitch twerr.Code() {")
+	g.P("\t\tcase twirp.Unavailable, twirp.DeadlineExceeded, twirp.Internal:")
+	g.P("\t\t\treturn true")
+	g.P("\t\tdefault:")
+	g.P("\t\t\treturn false")
+	g.P("\t\t}")
+	g.P("\t}")
+	g.P()
+	g.P("\tif nerr, ok := errors.Cause(err).(net.Error); ok {")
+	g.P("\t\treturn nerr.Timeout() || nerr.Temporary()")
+	g.P("\t}")
+	g.P()
+	g.P("\treturn false")
+	g.P("}")
+	g.P()
+
+	g.P("// ", svcName, " is a client-side middleware for ", serviceName(service), " that retries")
+	g.P("// transient failures with exponential backoff.")
+	g.P("type ", svcName, " struct {")
+	g.P("\tNext   ", serviceName(service))
+	g.P("\tConfig ", configName)
+	g.P("}")
+	g.P()
+
+	g.P("func New", svcName, "(next ", serviceName(service), ", cfg ", configName, ") ", serviceName(service), " {")
+	g.P("\tvar result ", svcName)
+	g.P("\tresult.Next = next")
+	g.P("\tresult.Config = cfg")
+	g.P("\treturn result")
+	g.P("}")
+	g.P()
+
+	for _, method := range service.Method {
+		methName := methodName(method)
+		miType := methodInputName(method)
+		moType := methodOutputName(method)
+		g.P("func (i ", svcName, ") ", methName, "(ctx context.Context, input *", miType, ") (result *", moType, ", err error) {")
+		g.P("\tdelay := i.Config.BaseDelay")
+		g.P()
+		g.P("\tfor attempt := 0; attempt <= i.Config.MaxRetries; attempt++ {")
+		g.P("\t\tresult, err = i.Next.", methName, "(ctx, input)")
+		g.P("\t\tif err == nil || !", isRetryableName, "(err) || attempt == i.Config.MaxRetries {")
+		g.P("\t\t\treturn result, err")
+		g.P("\t\t}")
+		g.P()
+		g.P("\t\tsleep := delay")
+		g.P("\t\tif sleep > i.Config.MaxDelay {")
+		g.P("\t\t\tsleep = i.Config.MaxDelay")
+		g.P("\t\t}")
+		g.P("\t\tif i.Config.Jitter && sleep > 0 {")
+		g.P("\t\t\tsleep = time.Duration(rand.Int63n(int64(sleep)))")
+		g.P("\t\t}")
+		g.P()
+		g.P("\t\tselect {")
+		g.P("\t\tcase <-ctx.Done():")
+		g.P("\t\t\treturn result, ctx.Err()")
+		g.P("\t\tcase <-time.After(sleep):")
+		g.P("\t\t}")
+		g.P()
+		g.P("\t\tdelay *= 2")
+		g.P("\t}")
+		g.P()
+		g.P("\treturn result, err")
+		g.P("}")
+		g.P()
+	}
+}
+
+func (g *generator) P(args ...string) {
+	for _, v := range args {
+		g.output.WriteString(v)
+	}
+	g.output.WriteByte('\n')
+}
+
+func (g *generator) printComments(comments typemap.DefinitionComments, prefix string) {
+	text := strings.TrimSuffix(comments.Leading, "\n")
+	for _, line := range strings.Split(text, "\n") {
+		g.P(prefix, strings.TrimPrefix(line, " "))
+	}
+}
+
+func serviceName(service *descriptor.ServiceDescriptorProto) string {
+	return stringutils.CamelCase(service.GetName())
+}
+
+func clientName(service *descriptor.ServiceDescriptorProto) string {
+	return serviceName(service) + "Client"
+}
+
+func fullServiceName(file *descriptor.FileDescriptorProto, service *descriptor.ServiceDescriptorProto) string {
+	name := serviceName(service)
+	if pkg := file.GetPackage(); pkg != "" {
+		name = pkg + "." + name
+	}
+	return name
+}
+
+func methodName(method *descriptor.MethodDescriptorProto) string {
+	return method.GetName()
+}
+
+// methodOutputName returns the basename of the output type of a method.
+func methodOutputName(meth *descriptor.MethodDescriptorProto) string {
+	fullName := meth.GetOutputType()
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}
+
+// methodInputName returns the basename of the input type of a method.
+func methodInputName(meth *descriptor.MethodDescriptorProto) string {
+	fullName := meth.GetInputType()
+	split := strings.Split(fullName, ".")
+	return split[len(split)-1]
+}